@@ -0,0 +1,377 @@
+// Package config populates a struct from command-line flags, environment
+// variables and struct-tag defaults, in that order of precedence.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	keyFlagTag      = "flag"
+	keyEnvTag       = "env"
+	keyDefaultTag   = "default"
+	keyRequiredTag  = "required"
+	keySeparatorTag = "separator"
+	keyKVSepTag     = "kvsep"
+
+	emptyPrefix = ""
+
+	defaultSeparator = ","
+	defaultKVSep     = "="
+)
+
+var (
+	// errInvalidReceiver is returned when Init is not given a pointer to a
+	// struct.
+	errInvalidReceiver = errors.New("config: receiver must be a pointer to a struct")
+	// errCantSet is returned when a struct field can't be set, e.g. it is
+	// unexported.
+	errCantSet = errors.New("config: can't set field value")
+)
+
+// errUnsupportedType is returned when a struct field's kind has no known
+// conversion from a raw string value.
+type errUnsupportedType string
+
+func (e errUnsupportedType) Error() string {
+	return fmt.Sprintf("config: unsupported type %q", string(e))
+}
+
+// errMissingRequired is returned when a field tagged `required:"true"` ends
+// up without a value from any source.
+type errMissingRequired string
+
+func (e errMissingRequired) Error() string {
+	return fmt.Sprintf("config: missing required value %q", string(e))
+}
+
+// errCantUseValue is returned when a raw value can't be converted to a
+// field's type.
+type errCantUseValue struct {
+	value  string
+	target interface{}
+}
+
+func errCantUse(value string, target interface{}) error {
+	return errCantUseValue{value: value, target: target}
+}
+
+func (e errCantUseValue) Error() string {
+	return fmt.Sprintf("config: can't use %q as %T", e.value, e.target)
+}
+
+// EnvPrefix is prepended to every environment variable name derived from a
+// struct field that has no explicit `env` tag.
+var EnvPrefix string
+
+// args returns the command-line arguments used to populate flags. It is a
+// variable so that, for instance, tests running under `go test` can strip
+// out flags belonging to the test binary itself.
+var args = func(arguments []string) []string {
+	return arguments
+}
+
+// Init populates config, a pointer to a struct, walking its fields
+// recursively. For every leaf field the value is taken from, in order of
+// precedence: a command-line flag, an environment variable, a config file
+// (given via the -config flag or the CONFIG_FILE environment variable, and
+// parsed as YAML, JSON or TOML depending on its extension), or the
+// `default` struct tag.
+//
+// Once every field has a value, each is checked against its `required` and
+// `validate` tags; Init returns every failure at once as Errors rather than
+// stopping at the first one. A single malformed or unsettable field (e.g.
+// an unsupported type) still aborts Init immediately.
+//
+// A `-help`/`-h` flag is registered on the underlying flag.FlagSet; passing
+// it prints the flags, environment variables, defaults, required/validate
+// rules and `usage:"..."` text for every field (see PrintDefaults) and
+// Init returns flag.ErrHelp.
+func Init(config interface{}, prefix string) error {
+	rv := reflect.ValueOf(config)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errInvalidReceiver
+	}
+
+	flagSet := flag.NewFlagSet("config", flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	flagSet.String(configFileFlag, "", "path to a config file (yaml, json or toml)")
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		PrintDefaults(os.Stderr, config)
+	}
+
+	arguments := args(os.Args[1:])
+
+	fileValues, err := loadConfigFile(arguments)
+	if err != nil {
+		return err
+	}
+
+	provided := make(map[string]bool)
+	if err := walk(rv.Elem(), flagSet, prefix, fileValues, provided); err != nil {
+		return err
+	}
+
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+	flagSet.Visit(func(f *flag.Flag) {
+		provided[f.Name] = true
+	})
+
+	var errs Errors
+	checkFields(rv.Elem(), prefix, provided, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// walk registers every leaf field of v with flagSet, applying values from
+// fileValues, the environment and defaults along the way, and records in
+// provided whether each field's flag key ended up with a value from one of
+// those sources. Required and validate tags are checked separately, by
+// checkFields, once flagSet has been parsed (which fills in provided with
+// any field set via a command-line flag).
+func walk(v reflect.Value, flagSet *flag.FlagSet, prefix string, fileValues map[string]string, provided map[string]bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+
+		if field.PkgPath != "" {
+			return errCantSet
+		}
+
+		dec, err := resolveDecoder(field, fv)
+		if err != nil {
+			return err
+		}
+
+		if dec == nil && fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Duration(0)) {
+			if err := walk(fv, flagSet, nestedPrefix(prefix, field.Name), fileValues, provided); err != nil {
+				return err
+			}
+			continue
+		}
+
+		flgKey := flagName(field, prefix)
+		envKey := envName(field, prefix)
+
+		val, hasVal := field.Tag.Lookup(keyDefaultTag)
+		if fileVal, ok := fileValues[fileKey(field, prefix)]; ok {
+			val, hasVal = fileVal, true
+		}
+		if envVal, ok := os.LookupEnv(envKey); ok {
+			val, hasVal = envVal, true
+		}
+
+		fval, err := newValue(fv, field)
+		if err != nil {
+			return err
+		}
+
+		flagSet.Var(fval, flgKey, field.Tag.Get(keyUsageTag))
+		if hasVal {
+			if err := fval.Set(val); err != nil {
+				return err
+			}
+		}
+		provided[flgKey] = hasVal
+	}
+	return nil
+}
+
+// value adapts a struct field to the flag.Value interface so that it can be
+// populated from a command-line flag, an environment variable or a default,
+// through a single code path.
+type value struct {
+	reflect.Value
+	sep, kvsep string
+	decoder    Decoder
+}
+
+// newValue builds a value for fv, taking its separator and key/value
+// separator from field's `separator`/`kvsep` tags (used when fv is a slice
+// or a map) and its Decoder from field's `decoder` tag or an implicit
+// encoding.TextUnmarshaler/json.Unmarshaler implementation.
+func newValue(fv reflect.Value, field reflect.StructField) (value, error) {
+	sep := field.Tag.Get(keySeparatorTag)
+	if sep == "" {
+		sep = defaultSeparator
+	}
+	kvsep := field.Tag.Get(keyKVSepTag)
+	if kvsep == "" {
+		kvsep = defaultKVSep
+	}
+	decoder, err := resolveDecoder(field, fv)
+	if err != nil {
+		return value{}, err
+	}
+	return value{fv, sep, kvsep, decoder}, nil
+}
+
+func (v value) String() string {
+	if !v.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+func (v value) Set(raw string) error {
+	if v.decoder != nil {
+		return v.decoder.Decode(raw, v.Value)
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		return v.setSlice(raw)
+	case reflect.Map:
+		return v.setMap(raw)
+	default:
+		return setScalar(v.Value, raw)
+	}
+}
+
+// setSlice parses raw as sep-separated tokens, converting each one to the
+// slice's element type.
+func (v value) setSlice(raw string) error {
+	tokens := splitNonEmpty(raw, v.sep)
+	slice := reflect.MakeSlice(v.Type(), len(tokens), len(tokens))
+	for i, tok := range tokens {
+		if err := setScalar(slice.Index(i), tok); err != nil {
+			return err
+		}
+	}
+	v.Value.Set(slice)
+	return nil
+}
+
+// setMap parses raw as sep-separated key/value pairs, each split on kvsep,
+// converting both sides to the map's key and element types.
+func (v value) setMap(raw string) error {
+	m := reflect.MakeMap(v.Type())
+	for _, tok := range splitNonEmpty(raw, v.sep) {
+		kv := strings.SplitN(tok, v.kvsep, 2)
+		if len(kv) != 2 {
+			return errCantUse(tok, v.Interface())
+		}
+		key := reflect.New(v.Type().Key()).Elem()
+		if err := setScalar(key, kv[0]); err != nil {
+			return err
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := setScalar(elem, kv[1]); err != nil {
+			return err
+		}
+		m.SetMapIndex(key, elem)
+	}
+	v.Value.Set(m)
+	return nil
+}
+
+// splitNonEmpty splits raw on sep, returning nil for an empty string.
+func splitNonEmpty(raw, sep string) []string {
+	if raw == "" {
+		return nil
+	}
+	return strings.Split(raw, sep)
+}
+
+// setScalar converts raw to v's scalar kind, returning errCantUse or
+// errUnsupportedType if the conversion fails.
+func setScalar(v reflect.Value, raw string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		v.SetBool(raw == "true")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return errCantUse(raw, v.Interface())
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		bits := v.Type().Bits()
+		i, err := strconv.ParseInt(raw, 10, bits)
+		if err != nil || v.OverflowInt(i) {
+			return errCantUse(raw, v.Interface())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		bits := v.Type().Bits()
+		u, err := strconv.ParseUint(raw, 10, bits)
+		if err != nil || v.OverflowUint(u) {
+			return errCantUse(raw, v.Interface())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		bits := v.Type().Bits()
+		f, err := strconv.ParseFloat(raw, bits)
+		if err != nil || v.OverflowFloat(f) {
+			return errCantUse(raw, v.Interface())
+		}
+		v.SetFloat(f)
+	default:
+		return errUnsupportedType(v.Kind().String())
+	}
+	return nil
+}
+
+// flagName returns the command-line flag name for field, honouring an
+// explicit `flag` tag or deriving one from prefix and the field name.
+func flagName(field reflect.StructField, prefix string) string {
+	if tag := field.Tag.Get(keyFlagTag); tag != "" {
+		return tag
+	}
+	return joinStrings("-", toKebabCase(prefix), toKebabCase(field.Name))
+}
+
+// envName returns the environment variable name for field, honouring an
+// explicit `env` tag or deriving one from EnvPrefix, prefix and the field
+// name.
+func envName(field reflect.StructField, prefix string) string {
+	if tag := field.Tag.Get(keyEnvTag); tag != "" {
+		return tag
+	}
+	return joinStrings("_", EnvPrefix, toSnakeCase(prefix), toSnakeCase(field.Name))
+}
+
+func toKebabCase(s string) string {
+	return strings.ReplaceAll(strings.ToLower(s), " ", "-")
+}
+
+func toSnakeCase(s string) string {
+	return strings.ReplaceAll(strings.ToUpper(s), " ", "_")
+}
+
+// joinStrings joins the non-empty parts with sep.
+func joinStrings(sep string, parts ...string) string {
+	var filtered []string
+	for _, p := range parts {
+		if p != "" {
+			filtered = append(filtered, p)
+		}
+	}
+	return strings.Join(filtered, sep)
+}
+
+// nestedPrefix builds the logical prefix used when walking into a nested
+// struct field, combining it with the prefix of the enclosing struct.
+func nestedPrefix(base, add string) string {
+	if base == "" {
+		return add
+	}
+	return base + " " + add
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	keyFileTag     = "file"
+	configFileFlag = "config"
+	envConfigFile  = "CONFIG_FILE"
+)
+
+// errUnsupportedFileType is returned when a config file's extension isn't
+// recognised.
+type errUnsupportedFileType string
+
+func (e errUnsupportedFileType) Error() string {
+	return fmt.Sprintf("config: unsupported config file type %q", string(e))
+}
+
+// loadConfigFile resolves the config file path from arguments or the
+// CONFIG_FILE environment variable and, if one is found, loads and
+// flattens it. It returns a nil map when no config file was requested.
+func loadConfigFile(arguments []string) (map[string]string, error) {
+	path := configFilePath(arguments)
+	if path == "" {
+		return nil, nil
+	}
+	return loadFile(path)
+}
+
+// configFilePath returns the config file path taken from the -config flag
+// in arguments, falling back to the CONFIG_FILE environment variable.
+func configFilePath(arguments []string) string {
+	for i, arg := range arguments {
+		switch {
+		case arg == "-"+configFileFlag || arg == "--"+configFileFlag:
+			if i+1 < len(arguments) {
+				return arguments[i+1]
+			}
+		case strings.HasPrefix(arg, "-"+configFileFlag+"="):
+			return strings.TrimPrefix(arg, "-"+configFileFlag+"=")
+		case strings.HasPrefix(arg, "--"+configFileFlag+"="):
+			return strings.TrimPrefix(arg, "--"+configFileFlag+"=")
+		}
+	}
+	return os.Getenv(envConfigFile)
+}
+
+// loadFile reads path, decodes it according to its extension and flattens
+// it into a dotted-path key/value map.
+func loadFile(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &data)
+	case ".json":
+		err = json.Unmarshal(raw, &data)
+	case ".toml":
+		err = toml.Unmarshal(raw, &data)
+	default:
+		return nil, errUnsupportedFileType(ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	flatten(emptyPrefix, data, values)
+	return values, nil
+}
+
+// flatten walks a decoded config file, building dotted, lower-cased keys
+// for every leaf value it finds. A map value is both recursed into, in
+// case it represents a nested struct, and rendered as a single
+// defaultSeparator/defaultKVSep-joined raw value under its own key, in
+// case the target field is a map; a list value is rendered the same way,
+// as a defaultSeparator-joined raw value, so both read the same as a
+// flag/env value would. flatten has no access to a field's `separator`/
+// `kvsep` tags, so a non-default separator on a slice or map field isn't
+// honoured for file-sourced values.
+func flatten(prefix string, in map[string]interface{}, out map[string]string) {
+	for key, val := range in {
+		key = joinStrings(".", prefix, strings.ToLower(key))
+		switch v := val.(type) {
+		case map[string]interface{}:
+			flatten(key, v, out)
+			out[key] = flattenMap(v)
+		case []interface{}:
+			out[key] = flattenSlice(v)
+		default:
+			out[key] = fmt.Sprintf("%v", v)
+		}
+	}
+}
+
+// flattenSlice renders a decoded list as a defaultSeparator-joined raw
+// value, matching what setSlice expects.
+func flattenSlice(in []interface{}) string {
+	tokens := make([]string, len(in))
+	for i, v := range in {
+		tokens[i] = flattenScalar(v)
+	}
+	return strings.Join(tokens, defaultSeparator)
+}
+
+// flattenMap renders a decoded mapping as a defaultSeparator/defaultKVSep
+// -joined raw value, matching what setMap expects. The key/value tokens
+// are sorted for a deterministic result.
+func flattenMap(in map[string]interface{}) string {
+	tokens := make([]string, 0, len(in))
+	for k, v := range in {
+		tokens = append(tokens, strings.ToLower(k)+defaultKVSep+flattenScalar(v))
+	}
+	sort.Strings(tokens)
+	return strings.Join(tokens, defaultSeparator)
+}
+
+// flattenScalar renders a single decoded value as setScalar would expect,
+// recursing through flattenSlice/flattenMap for nested collections.
+func flattenScalar(v interface{}) string {
+	switch vv := v.(type) {
+	case []interface{}:
+		return flattenSlice(vv)
+	case map[string]interface{}:
+		return flattenMap(vv)
+	default:
+		return fmt.Sprintf("%v", vv)
+	}
+}
+
+// fileKey returns the config file lookup key for field, honouring an
+// explicit `file` tag or falling back to its `yaml`/`json` tag name, then
+// the field name itself, nested under prefix.
+func fileKey(field reflect.StructField, prefix string) string {
+	path := strings.ToLower(strings.ReplaceAll(prefix, " ", "."))
+	if tag := field.Tag.Get(keyFileTag); tag != "" {
+		return joinStrings(".", path, tag)
+	}
+	name := field.Name
+	if tag := tagName(field.Tag.Get("yaml")); tag != "" {
+		name = tag
+	} else if tag := tagName(field.Tag.Get("json")); tag != "" {
+		name = tag
+	}
+	return joinStrings(".", path, strings.ToLower(name))
+}
+
+// tagName strips options (e.g. ",omitempty") off a struct tag value.
+func tagName(tag string) string {
+	return strings.SplitN(tag, ",", 2)[0]
+}
@@ -1,7 +1,12 @@
 package config
 
 import (
-	"flag"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -28,7 +33,7 @@ func init() {
 		SKIP:
 		}
 		return
-	}(args)
+	}
 }
 
 func Test_JoinStrings(t *testing.T) {
@@ -162,201 +167,422 @@ func Test_EnvName(t *testing.T) {
 	})
 }
 
-func Test_SetValue(t *testing.T) {
+func Test_NewValue_Scalars(t *testing.T) {
 	type testStruct struct {
 		D   time.Duration
 		I   int
+		I8  int8
+		I16 int16
+		I32 int32
 		I64 int64
 		U   uint
+		U8  uint8
+		U16 uint16
+		U32 uint32
 		U64 uint64
 		S   string
 		B   bool
 		F32 float32
 		F64 float64
-	}
-	type in struct {
-		field         reflect.Value
-		flgKey, value string
+		C   complex64
 	}
 	type testCase struct {
-		title string
-		in    in
-		out   interface{}
-		err   error
+		title      string
+		fieldName  string
+		value      string
+		out        interface{}
+		errMessage string
 	}
-	var reflectStruct = reflect.Indirect(reflect.ValueOf(new(testStruct)))
+	var reflectType = reflect.TypeOf(testStruct{})
 	var cases = []testCase{
+		{title: "time.Duration", fieldName: "D", value: "3h", out: time.Duration(10800000000000)},
+		{title: "int value", fieldName: "I", value: "123", out: int(123)},
+		{title: "int64 value", fieldName: "I64", value: "234", out: int64(234)},
+		{title: "uint value", fieldName: "U", value: "345", out: uint(345)},
+		{title: "uint64 value", fieldName: "U64", value: "456", out: uint64(456)},
+		{title: "int8 value", fieldName: "I8", value: "12", out: int8(12)},
+		{title: "int16 value", fieldName: "I16", value: "1234", out: int16(1234)},
+		{title: "int32 value", fieldName: "I32", value: "123456", out: int32(123456)},
+		{title: "uint8 value", fieldName: "U8", value: "123", out: uint8(123)},
+		{title: "uint16 value", fieldName: "U16", value: "1234", out: uint16(1234)},
+		{title: "uint32 value", fieldName: "U32", value: "123456", out: uint32(123456)},
 		{
-			title: "time.Duration",
-			in: in{
-				reflectStruct.FieldByName("D"),
-				"flag-test",
-				"3h",
-			},
-			out: time.Duration(10800000000000),
-		},
-		{
-			title: "int value",
-			in: in{
-				reflectStruct.FieldByName("I"),
-				"flag-test",
-				"123",
-			},
-			out: int(123),
-		},
-		{
-			title: "int64 value",
-			in: in{
-				reflectStruct.FieldByName("I64"),
-				"flag-test",
-				"234",
-			},
-			out: int64(234),
-		},
-		{
-			title: "uint value",
-			in: in{
-				reflectStruct.FieldByName("U"),
-				"flag-test",
-				"345",
-			},
-			out: uint(345),
+			title: "int8 overflow", fieldName: "I8", value: "1000",
+			out: int8(0), errMessage: `config: can't use "1000" as int8`,
 		},
 		{
-			title: "uint64 value",
-			in: in{
-				reflectStruct.FieldByName("U64"),
-				"flag-test",
-				"456",
-			},
-			out: uint64(456),
+			title: "uint8 overflow", fieldName: "U8", value: "1000",
+			out: uint8(0), errMessage: `config: can't use "1000" as uint8`,
 		},
+		{title: "float64 value", fieldName: "F64", value: "567.89", out: float64(567.89)},
+		{title: "float32 value", fieldName: "F32", value: "3.25", out: float32(3.25)},
+		{title: "bool value", fieldName: "B", value: "true", out: true},
+		{title: "string value", fieldName: "S", value: "test string", out: "test string"},
 		{
-			title: "float64 value",
-			in: in{
-				reflectStruct.FieldByName("F64"),
-				"flag-test",
-				"567.89",
-			},
-			out: float64(567.89),
+			title: "unsupported complex64 value", fieldName: "C", value: "1+2i",
+			out: complex64(0), errMessage: `config: unsupported type "complex64"`,
 		},
 		{
-			title: "bool value",
-			in: in{
-				reflectStruct.FieldByName("B"),
-				"flag-test",
-				"true",
-			},
-			out: true,
+			title: "wrong time.Duration", fieldName: "D", value: "wrong",
+			out: time.Duration(0), errMessage: `config: can't use "wrong" as time.Duration`,
 		},
 		{
-			title: "string value",
-			in: in{
-				reflectStruct.FieldByName("S"),
-				"flag-test",
-				"test string",
-			},
-			out: "test string",
+			title: "wrong int value", fieldName: "I", value: "wrong",
+			out: int(0), errMessage: `config: can't use "wrong" as int`,
 		},
 		{
-			title: "unsupported float32 value",
-			in: in{
-				reflectStruct.FieldByName("F32"),
-				"flag-test",
-				"3.14159",
-			},
-			out: 0,
-			err: errUnsupportedType(reflectStruct.FieldByName("F32").Kind().String()),
+			title: "wrong uint value", fieldName: "U", value: "wrong",
+			out: uint(0), errMessage: `config: can't use "wrong" as uint`,
 		},
 		{
-			title: "wrong time.Duration",
-			in: in{
-				reflectStruct.FieldByName("D"),
-				"flag-test",
-				"wrong",
-			},
-			out: time.Duration(10800000000000),
-			err: errCantUse("wrong", *new(time.Duration)),
-		},
-		{
-			title: "wrong int value",
-			in: in{
-				reflect.Indirect(
-					reflect.ValueOf(new(testStruct)),
-				).FieldByName("I"),
-				"flag-test",
-				"wrong",
-			},
-			out: 0,
-			err: errCantUse("wrong", *new(int)),
+			title: "wrong int64 value", fieldName: "I64", value: "wrong",
+			out: int64(0), errMessage: `config: can't use "wrong" as int64`,
 		},
 		{
-			title: "wrong uint value",
-			in: in{
-				reflect.Indirect(
-					reflect.ValueOf(new(testStruct)),
-				).FieldByName("U"),
-				"flag-test",
-				"wrong",
-			},
-			out: 0,
-			err: errCantUse("wrong", *new(uint)),
+			title: "wrong uint64 value", fieldName: "U64", value: "wrong",
+			out: uint64(0), errMessage: `config: can't use "wrong" as uint64`,
 		},
 		{
-			title: "wrong int64 value",
-			in: in{
-				reflect.Indirect(
-					reflect.ValueOf(new(testStruct)),
-				).FieldByName("I64"),
-				"flag-test",
-				"wrong",
-			},
-			out: 0,
-			err: errCantUse("wrong", *new(int64)),
+			title: "wrong float64 value", fieldName: "F64", value: "wrong",
+			out: float64(0), errMessage: `config: can't use "wrong" as float64`,
 		},
+		{title: "wrong bool value", fieldName: "B", value: "wrong", out: false},
+	}
+	Convey("Setting values", t, func() {
+		for _, c := range cases {
+			Convey(c.title, func() {
+				field, _ := reflectType.FieldByName(c.fieldName)
+				fv := reflect.Indirect(reflect.ValueOf(new(testStruct))).FieldByName(c.fieldName)
+				v, err := newValue(fv, field)
+				So(err, ShouldBeNil)
+				err = v.Set(c.value)
+				So(fv.Interface(), ShouldEqual, c.out)
+				if c.errMessage == "" {
+					So(err, ShouldBeNil)
+					return
+				}
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, c.errMessage)
+			})
+		}
+	})
+}
+
+func Test_NewValue_Collections(t *testing.T) {
+	type testStruct struct {
+		Ints   []int
+		Strs   []string
+		Labels map[string]int
+		BadKV  map[string]int
+	}
+	type testCase struct {
+		title       string
+		fieldName   string
+		value       string
+		out         interface{}
+		errExpected bool
+	}
+	var cases = []testCase{
+		{title: "slice of ints", fieldName: "Ints", value: "1,2,3", out: []int{1, 2, 3}},
+		{title: "slice of strings", fieldName: "Strs", value: "a,b,c", out: []string{"a", "b", "c"}},
+		{title: "map of string to int", fieldName: "Labels", value: "x=1,y=2", out: map[string]int{"x": 1, "y": 2}},
+		{title: "slice with invalid element", fieldName: "Ints", value: "1,wrong,3", errExpected: true},
+		{title: "map with missing kvsep", fieldName: "BadKV", value: "x1,y=2", errExpected: true},
+	}
+	var reflectType = reflect.TypeOf(testStruct{})
+	Convey("Setting slice and map values", t, func() {
+		for _, c := range cases {
+			Convey(c.title, func() {
+				reflectStruct := reflect.Indirect(reflect.ValueOf(new(testStruct)))
+				field, _ := reflectType.FieldByName(c.fieldName)
+				fv := reflectStruct.FieldByName(c.fieldName)
+				v, err := newValue(fv, field)
+				So(err, ShouldBeNil)
+				err = v.Set(c.value)
+				if c.errExpected {
+					So(err, ShouldNotBeNil)
+					return
+				}
+				So(err, ShouldBeNil)
+				So(fv.Interface(), ShouldResemble, c.out)
+			})
+		}
+	})
+}
+
+type upperDecoder struct{}
+
+func (upperDecoder) Decode(raw string, target reflect.Value) error {
+	target.SetString(strings.ToUpper(raw))
+	return nil
+}
+
+func Test_Decoder(t *testing.T) {
+	Convey("Decoder", t, func() {
+		Convey("implicit encoding.TextUnmarshaler", func() {
+			var s struct {
+				IP net.IP
+			}
+			field := reflect.TypeOf(s).Field(0)
+			fv := reflect.Indirect(reflect.ValueOf(&s)).Field(0)
+			v, err := newValue(fv, field)
+			So(err, ShouldBeNil)
+			So(v.Set("127.0.0.1"), ShouldBeNil)
+			So(s.IP.String(), ShouldEqual, "127.0.0.1")
+		})
+		Convey("registered decoder via tag", func() {
+			RegisterDecoder("upper", upperDecoder{})
+			var s struct {
+				Name string `decoder:"upper"`
+			}
+			field := reflect.TypeOf(s).Field(0)
+			fv := reflect.Indirect(reflect.ValueOf(&s)).Field(0)
+			v, err := newValue(fv, field)
+			So(err, ShouldBeNil)
+			So(v.Set("abc"), ShouldBeNil)
+			So(s.Name, ShouldEqual, "ABC")
+		})
+		Convey("unknown decoder", func() {
+			var s struct {
+				Name string `decoder:"missing"`
+			}
+			field := reflect.TypeOf(s).Field(0)
+			fv := reflect.Indirect(reflect.ValueOf(&s)).Field(0)
+			_, err := newValue(fv, field)
+			So(err, ShouldResemble, errUnknownDecoder("missing"))
+		})
+	})
+}
+
+func Test_ConfigFilePath(t *testing.T) {
+	type testCase struct {
+		title string
+		in    []string
+		env   string
+		out   string
+	}
+	var cases = []testCase{
+		{"not provided", []string{"-other", "value"}, "", ""},
+		{"flag with space", []string{"-config", "path/to/file.yaml"}, "", "path/to/file.yaml"},
+		{"flag with equals", []string{"--config=path/to/file.json"}, "", "path/to/file.json"},
+		{"falls back to env", []string{}, "path/to/file.toml", "path/to/file.toml"},
+	}
+	Convey("Config file path", t, func() {
+		for _, c := range cases {
+			Convey(c.title, func() {
+				os.Setenv(envConfigFile, c.env)
+				defer os.Unsetenv(envConfigFile)
+				So(configFilePath(c.in), ShouldEqual, c.out)
+			})
+		}
+	})
+}
+
+func Test_Flatten(t *testing.T) {
+	Convey("Flatten", t, func() {
+		Convey("nested struct", func() {
+			in := map[string]interface{}{
+				"Host": "localhost",
+				"Db": map[string]interface{}{
+					"Port": 5432,
+				},
+			}
+			out := make(map[string]string)
+			flatten(emptyPrefix, in, out)
+			So(out, ShouldResemble, map[string]string{
+				"host":    "localhost",
+				"db.port": "5432",
+				"db":      "port=5432",
+			})
+		})
+
+		Convey("list value", func() {
+			in := map[string]interface{}{
+				"Hosts": []interface{}{"a", "b", "c"},
+			}
+			out := make(map[string]string)
+			flatten(emptyPrefix, in, out)
+			So(out, ShouldResemble, map[string]string{
+				"hosts": "a,b,c",
+			})
+		})
+
+		Convey("map value", func() {
+			in := map[string]interface{}{
+				"Labels": map[string]interface{}{
+					"x": 1,
+					"y": 2,
+				},
+			}
+			out := make(map[string]string)
+			flatten(emptyPrefix, in, out)
+			So(out, ShouldResemble, map[string]string{
+				"labels":   "x=1,y=2",
+				"labels.x": "1",
+				"labels.y": "2",
+			})
+		})
+	})
+}
+
+func Test_FileKey(t *testing.T) {
+	type In struct {
+		field  reflect.StructField
+		prefix string
+	}
+	type testCase struct {
+		title string
+		in    In
+		out   string
+	}
+	var cases = []testCase{
 		{
-			title: "wrong uint64 value",
-			in: in{
-				reflect.Indirect(
-					reflect.ValueOf(new(testStruct)),
-				).FieldByName("U64"),
-				"flag-test",
-				"wrong",
+			"derived from field name",
+			In{
+				reflect.StructField{Name: "Port", Type: reflect.TypeOf(0)},
+				"Db",
 			},
-			out: 0,
-			err: errCantUse("wrong", *new(uint64)),
+			"db.port",
 		},
 		{
-			title: "wrong float64 value",
-			in: in{
-				reflect.Indirect(
-					reflect.ValueOf(new(testStruct)),
-				).FieldByName("F64"),
-				"flag-test",
-				"wrong",
+			"with explicit file tag",
+			In{
+				reflect.StructField{
+					Name: "Port",
+					Tag:  keyFileTag + `:"listen_port"`,
+					Type: reflect.TypeOf(0),
+				},
+				"Db",
 			},
-			out: 0,
-			err: errCantUse("wrong", *new(float64)),
+			"db.listen_port",
 		},
 		{
-			title: "wrong bool value",
-			in: in{
-				reflect.Indirect(
-					reflect.ValueOf(new(testStruct)),
-				).FieldByName("B"),
-				"flag-test",
-				"wrong",
+			"with yaml tag",
+			In{
+				reflect.StructField{
+					Name: "Port",
+					Tag:  `yaml:"port,omitempty"`,
+					Type: reflect.TypeOf(0),
+				},
+				"Db",
 			},
-			out: false,
+			"db.port",
 		},
 	}
-	Convey("Setting values", t, func() {
+	Convey("File key", t, func() {
 		for _, c := range cases {
 			Convey(c.title, func() {
-				flagSet := flag.NewFlagSet("config", flag.ContinueOnError)
-				err := setValue(c.in.field, flagSet, c.in.flgKey, c.in.value)
-				So(c.in.field.Interface(), ShouldEqual, c.out)
-				So(err, ShouldResemble, c.err)
+				So(fileKey(c.in.field, c.in.prefix), ShouldEqual, c.out)
+			})
+		}
+	})
+}
+
+func Test_PrintDefaults(t *testing.T) {
+	Convey("PrintDefaults", t, func() {
+		Convey("only pointer to struct is supported", func() {
+			So(PrintDefaults(io.Discard, new(int64)), ShouldResemble, errInvalidReceiver)
+		})
+
+		Convey("lists every field", func() {
+			EnvPrefix = ""
+			var buf bytes.Buffer
+			cfg := &struct {
+				Host   string `default:"localhost" required:"true" usage:"database host"`
+				Nested struct {
+					Port int `validate:"min=1,max=65535"`
+				}
+			}{}
+			err := PrintDefaults(&buf, cfg)
+			So(err, ShouldBeNil)
+			out := buf.String()
+			So(out, ShouldContainSubstring, "-host")
+			So(out, ShouldContainSubstring, "env: HOST")
+			So(out, ShouldContainSubstring, "default: localhost")
+			So(out, ShouldContainSubstring, "required")
+			So(out, ShouldContainSubstring, "database host")
+			So(out, ShouldContainSubstring, "-nested-port")
+			So(out, ShouldContainSubstring, "validate: min=1,max=65535")
+		})
+
+		Convey("a field with an implicit decoder is printed as a leaf", func() {
+			var buf bytes.Buffer
+			cfg := &struct {
+				Created time.Time
+			}{}
+			err := PrintDefaults(&buf, cfg)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, "-created")
+		})
+
+		Convey("a decoder-tagged struct field is printed under its own flag name", func() {
+			RegisterDecoder("upper", upperDecoder{})
+			var buf bytes.Buffer
+			cfg := &struct {
+				Addr struct {
+					Inner string
+				} `decoder:"upper"`
+			}{}
+			err := PrintDefaults(&buf, cfg)
+			So(err, ShouldBeNil)
+			out := buf.String()
+			So(out, ShouldContainSubstring, "-addr\n")
+			So(out, ShouldNotContainSubstring, "-addr-inner")
+		})
+
+		Convey("an unknown decoder tag is reported", func() {
+			var buf bytes.Buffer
+			cfg := &struct {
+				Name string `decoder:"missing"`
+			}{}
+			So(PrintDefaults(&buf, cfg), ShouldResemble, errUnknownDecoder("missing"))
+		})
+	})
+}
+
+func Test_ValidateRule(t *testing.T) {
+	type testStruct struct {
+		I    int
+		S    string
+		Strs []string
+	}
+	type testCase struct {
+		title string
+		field string
+		set   interface{}
+		rule  string
+		valid bool
+	}
+	var cases = []testCase{
+		{"min satisfied", "I", 5, "min=1", true},
+		{"min violated", "I", 0, "min=1", false},
+		{"max satisfied", "I", 5, "max=10", true},
+		{"max violated", "I", 11, "max=10", false},
+		{"len satisfied", "Strs", []string{"a", "b"}, "len=2", true},
+		{"len violated", "Strs", []string{"a"}, "len=2", false},
+		{"oneof satisfied", "S", "b", "oneof=a|b|c", true},
+		{"oneof violated", "S", "d", "oneof=a|b|c", false},
+		{"regexp satisfied", "S", "abc123", `regexp=^[a-z]+\d+$`, true},
+		{"regexp violated", "S", "123abc", `regexp=^[a-z]+\d+$`, false},
+		{"nonzero satisfied", "I", 1, "nonzero", true},
+		{"nonzero violated", "I", 0, "nonzero", false},
+	}
+	Convey("Validate rule", t, func() {
+		for _, c := range cases {
+			Convey(c.title, func() {
+				s := reflect.Indirect(reflect.ValueOf(new(testStruct)))
+				fv := s.FieldByName(c.field)
+				fv.Set(reflect.ValueOf(c.set))
+				err := validateRule(fv, c.field, c.rule)
+				if c.valid {
+					So(err, ShouldBeNil)
+				} else {
+					So(err, ShouldResemble, ValidationError{
+						Field: c.field,
+						Rule:  c.rule,
+						Value: fmt.Sprintf("%v", c.set),
+					})
+				}
 			})
 		}
 	})
@@ -398,20 +624,20 @@ func Test_Init(t *testing.T) {
 			{
 				title: "unsupported type",
 				config: &struct {
-					Value float32 `default:"3.14159"`
+					Value complex64 `default:"1+2i"`
 				}{},
 				prefix: emptyPrefix,
-				error:  errUnsupportedType("float32"),
+				error:  errUnsupportedType("complex64"),
 			},
 			{
 				title: "nested struct unsupported type",
 				config: &struct {
 					Struct struct {
-						Value float32 `default:"3.14159"`
+						Value complex64 `default:"1+2i"`
 					}
 				}{},
 				prefix: emptyPrefix,
-				error:  errUnsupportedType("float32"),
+				error:  errUnsupportedType("complex64"),
 			},
 			{
 				title: "check required value",
@@ -419,7 +645,48 @@ func Test_Init(t *testing.T) {
 					Value int `required:"true"`
 				}{},
 				prefix: emptyPrefix,
-				error:  errMissingRequired("value"),
+				error:  Errors{errMissingRequired("value")},
+			},
+			{
+				title: "aggregate errors across multiple fields",
+				config: &struct {
+					First  int `required:"true"`
+					Second int `required:"true"`
+				}{},
+				prefix: emptyPrefix,
+				error:  Errors{errMissingRequired("first"), errMissingRequired("second")},
+			},
+			{
+				title: "required bool explicitly set to false is satisfied",
+				config: &struct {
+					Enabled bool `required:"true" default:"false"`
+				}{},
+				prefix: emptyPrefix,
+				error:  nil,
+			},
+			{
+				title: "required numeric field explicitly set to zero is satisfied",
+				config: &struct {
+					Count int `required:"true" default:"0"`
+				}{},
+				prefix: emptyPrefix,
+				error:  nil,
+			},
+			{
+				title: "validate tag failure",
+				config: &struct {
+					Value int `default:"42" validate:"max=10"`
+				}{},
+				prefix: emptyPrefix,
+				error:  Errors{ValidationError{Field: "value", Rule: "max=10", Value: "42"}},
+			},
+			{
+				title: "validate len rule on a kind without Len does not panic",
+				config: &struct {
+					Value int `validate:"len=3"`
+				}{},
+				prefix: emptyPrefix,
+				error:  Errors{ValidationError{Field: "value", Rule: "len=3", Value: "0"}},
 			},
 			{
 				title: "set struct default value",
@@ -439,6 +706,14 @@ func Test_Init(t *testing.T) {
 				prefix: emptyPrefix,
 				error:  nil,
 			},
+			{
+				title: "struct field with an implicit decoder is decoded, not recursed into",
+				config: &struct {
+					Start time.Time `default:"2024-01-02T15:04:05Z"`
+				}{},
+				prefix: emptyPrefix,
+				error:  nil,
+			},
 		}
 		for _, c := range tc {
 			Convey(c.title, func() {
@@ -447,4 +722,39 @@ func Test_Init(t *testing.T) {
 			})
 		}
 	})
-}
\ No newline at end of file
+}
+
+func Test_Init_CustomSeparator(t *testing.T) {
+	Convey("Init honours separator/kvsep tags", t, func() {
+		var cfg struct {
+			Hosts  []string       `default:"a|b|c" separator:"|"`
+			Labels map[string]int `default:"x:1;y:2" separator:";" kvsep:":"`
+		}
+		So(Init(&cfg, emptyPrefix), ShouldBeNil)
+		So(cfg.Hosts, ShouldResemble, []string{"a", "b", "c"})
+		So(cfg.Labels, ShouldResemble, map[string]int{"x": 1, "y": 2})
+	})
+}
+
+func Test_Init_ConfigFile(t *testing.T) {
+	Convey("Init reads slice and map fields from a real config file", t, func() {
+		var cfg struct {
+			Host   string         `yaml:"host"`
+			Hosts  []string       `yaml:"hosts"`
+			Labels map[string]int `yaml:"labels"`
+		}
+
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		err := os.WriteFile(path, []byte("host: db.local\nhosts: [a, b, c]\nlabels:\n  x: 1\n  y: 2\n"), 0o600)
+		So(err, ShouldBeNil)
+
+		originalArgs := os.Args
+		os.Args = []string{"cmd", "-config", path}
+		defer func() { os.Args = originalArgs }()
+
+		So(Init(&cfg, emptyPrefix), ShouldBeNil)
+		So(cfg.Host, ShouldEqual, "db.local")
+		So(cfg.Hosts, ShouldResemble, []string{"a", "b", "c"})
+		So(cfg.Labels, ShouldResemble, map[string]int{"x": 1, "y": 2})
+	})
+}
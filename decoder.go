@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+const keyDecoderTag = "decoder"
+
+// Decoder converts a raw string value into target, a settable, addressable
+// reflect.Value. Register implementations with RegisterDecoder and opt a
+// field into one with a `decoder:"name"` struct tag.
+type Decoder interface {
+	Decode(raw string, target reflect.Value) error
+}
+
+var decoders = make(map[string]Decoder)
+
+// RegisterDecoder makes d available to fields tagged `decoder:"name"`.
+func RegisterDecoder(name string, d Decoder) {
+	decoders[name] = d
+}
+
+// errUnknownDecoder is returned when a field's `decoder` tag names a
+// decoder that was never registered.
+type errUnknownDecoder string
+
+func (e errUnknownDecoder) Error() string {
+	return fmt.Sprintf("config: unknown decoder %q", string(e))
+}
+
+// resolveDecoder returns the Decoder field should use, taken from its
+// `decoder` tag, falling back to an implicit decoder when fv's type
+// implements encoding.TextUnmarshaler or json.Unmarshaler.
+func resolveDecoder(field reflect.StructField, fv reflect.Value) (Decoder, error) {
+	if name := field.Tag.Get(keyDecoderTag); name != "" {
+		d, ok := decoders[name]
+		if !ok {
+			return nil, errUnknownDecoder(name)
+		}
+		return d, nil
+	}
+	return implicitDecoder(fv), nil
+}
+
+func implicitDecoder(fv reflect.Value) Decoder {
+	if !fv.CanAddr() {
+		return nil
+	}
+	switch fv.Addr().Interface().(type) {
+	case encoding.TextUnmarshaler:
+		return textUnmarshalerDecoder{}
+	case json.Unmarshaler:
+		return jsonUnmarshalerDecoder{}
+	}
+	return nil
+}
+
+// textUnmarshalerDecoder decodes through target's encoding.TextUnmarshaler
+// implementation.
+type textUnmarshalerDecoder struct{}
+
+func (textUnmarshalerDecoder) Decode(raw string, target reflect.Value) error {
+	return target.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+}
+
+// jsonUnmarshalerDecoder decodes through target's json.Unmarshaler
+// implementation.
+type jsonUnmarshalerDecoder struct{}
+
+func (jsonUnmarshalerDecoder) Decode(raw string, target reflect.Value) error {
+	return target.Addr().Interface().(json.Unmarshaler).UnmarshalJSON([]byte(raw))
+}
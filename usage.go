@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+const keyUsageTag = "usage"
+
+// PrintDefaults writes a human-readable summary of every flag Init would
+// register for cfg, a pointer to a struct: its flag name, environment
+// variable name, default value, required/validate rules and usage text.
+func PrintDefaults(w io.Writer, cfg interface{}) error {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errInvalidReceiver
+	}
+	return printFields(w, rv.Elem(), emptyPrefix)
+}
+
+func printFields(w io.Writer, v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		dec, err := resolveDecoder(field, fv)
+		if err != nil {
+			return err
+		}
+
+		if dec == nil && fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Duration(0)) {
+			if err := printFields(w, fv, nestedPrefix(prefix, field.Name)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fmt.Fprintf(w, "  -%s\n", flagName(field, prefix))
+		fmt.Fprintf(w, "\tenv: %s\n", envName(field, prefix))
+		if def, ok := field.Tag.Lookup(keyDefaultTag); ok {
+			fmt.Fprintf(w, "\tdefault: %s\n", def)
+		}
+		if field.Tag.Get(keyRequiredTag) == "true" {
+			fmt.Fprintln(w, "\trequired")
+		}
+		if rule := field.Tag.Get(keyValidateTag); rule != "" {
+			fmt.Fprintf(w, "\tvalidate: %s\n", rule)
+		}
+		if usage := field.Tag.Get(keyUsageTag); usage != "" {
+			fmt.Fprintf(w, "\t%s\n", usage)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const keyValidateTag = "validate"
+
+// ValidationError describes a single struct field that failed one of its
+// `validate` tag rules.
+type ValidationError struct {
+	Field, Rule, Value string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("config: field %q failed validation rule %q (value %q)", e.Field, e.Rule, e.Value)
+}
+
+// Errors aggregates every error Init collected while checking required and
+// validate tags, rather than stopping at the first one.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// checkFields walks v, already populated by walk and flagSet.Parse,
+// appending an errMissingRequired or ValidationError to errs for every
+// field that fails its `required` or `validate` tag. provided records, per
+// flag key, whether walk (or flagSet.Parse) actually supplied a value for
+// that field, which is what `required` cares about rather than the
+// populated value itself.
+func checkFields(v reflect.Value, prefix string, provided map[string]bool, errs *Errors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+
+		flgKey := flagName(field, prefix)
+
+		if _, ok := provided[flgKey]; !ok && fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Duration(0)) {
+			checkFields(fv, nestedPrefix(prefix, field.Name), provided, errs)
+			continue
+		}
+
+		if field.Tag.Get(keyRequiredTag) == "true" && !provided[flgKey] {
+			*errs = append(*errs, errMissingRequired(flgKey))
+			continue
+		}
+
+		for _, rule := range splitNonEmpty(field.Tag.Get(keyValidateTag), ",") {
+			if err := validateRule(fv, flgKey, rule); err != nil {
+				*errs = append(*errs, err)
+			}
+		}
+	}
+}
+
+// validateRule checks fv against a single `validate` tag rule, e.g.
+// "min=1", "oneof=a|b|c" or "nonzero".
+func validateRule(fv reflect.Value, flgKey, rule string) error {
+	name, arg := rule, ""
+	if i := strings.IndexByte(rule, '='); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+
+	fail := func() error {
+		return ValidationError{Field: flgKey, Rule: rule, Value: fmt.Sprintf("%v", fv.Interface())}
+	}
+
+	switch name {
+	case "nonzero":
+		if fv.IsZero() {
+			return fail()
+		}
+	case "min":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil || toFloat(fv) < limit {
+			return fail()
+		}
+	case "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil || toFloat(fv) > limit {
+			return fail()
+		}
+	case "len":
+		if !hasLen(fv) {
+			return fail()
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || fv.Len() != n {
+			return fail()
+		}
+	case "oneof":
+		value := fmt.Sprintf("%v", fv.Interface())
+		for _, opt := range strings.Split(arg, "|") {
+			if opt == value {
+				return nil
+			}
+		}
+		return fail()
+	case "regexp":
+		re, err := regexp.Compile(arg)
+		if err != nil || !re.MatchString(fmt.Sprintf("%v", fv.Interface())) {
+			return fail()
+		}
+	}
+	return nil
+}
+
+// hasLen reports whether fv's kind supports reflect.Value.Len, for the
+// "len" validate rule.
+func hasLen(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice, reflect.String:
+		return true
+	case reflect.Ptr:
+		return fv.Type().Elem().Kind() == reflect.Array
+	default:
+		return false
+	}
+}
+
+// toFloat returns fv's value as a float64, for numeric comparison rules.
+func toFloat(fv reflect.Value) float64 {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return fv.Float()
+	default:
+		return 0
+	}
+}